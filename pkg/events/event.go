@@ -0,0 +1,102 @@
+// Package events defines the crawler's structured event stream: every
+// peer-lifecycle occurrence the p2p layer observes, and the sinks that
+// can consume it (JSONL file, log15, Prometheus, an optional pub/sub
+// publisher, and a backpressured fan-out over all of them).
+package events
+
+import (
+	"time"
+
+	"github.com/Fantom-foundation/go-opera/gossip"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// Kind identifies what happened to produce a CrawlerEvent.
+type Kind string
+
+const (
+	// PeerDiscovered fires once per inbound or outbound connection,
+	// before the Opera handshake is attempted.
+	PeerDiscovered Kind = "peer_discovered"
+
+	// HandshakeOK and HandshakeFailed fire once the Opera handshake
+	// with a peer completes, successfully or not.
+	HandshakeOK     Kind = "handshake_ok"
+	HandshakeFailed Kind = "handshake_failed"
+
+	// ProgressObserved fires every time a peer reports its PeerProgress.
+	ProgressObserved Kind = "progress_observed"
+
+	// VerdictDecided fires once a peer's Status settles on a terminal
+	// verdict (honest, evil, useless, or unknown).
+	VerdictDecided Kind = "verdict_decided"
+
+	// PeerDisconnected fires once, right before a peer connection is
+	// torn down, with the reason if it wasn't a clean disconnect. It only
+	// fires for peers that got past the handshake and local registration;
+	// a peer dropped earlier gets no PeerDisconnected.
+	PeerDisconnected Kind = "peer_disconnected"
+
+	// HandshakeRejected fires when the Handler rejects a peer right
+	// after a successful Opera handshake (Handler.OnHandshake returned
+	// an error).
+	HandshakeRejected Kind = "handshake_rejected"
+
+	// PeerRegistrationFailed fires when a handshaked, handler-accepted
+	// peer fails local registration (e.g. it's already connected).
+	PeerRegistrationFailed Kind = "peer_registration_failed"
+
+	// LeechStarted fires when a peer's self-reported progress looks
+	// inconsistent and a DAG leecher is spawned to check it against the
+	// genesis rules instead of taking the peer's word for it.
+	LeechStarted Kind = "leech_started"
+
+	// LeechDiagnostic fires for internal DAG-leech occurrences that
+	// aren't themselves a verdict - a request failing, a chunk failing
+	// verification, the fetch cap being hit, or the request timing out.
+	// Reason identifies which.
+	LeechDiagnostic Kind = "leech_diagnostic"
+
+	// EventsReceived fires when a peer sends full event payloads
+	// (EventsMsg).
+	EventsReceived Kind = "events_received"
+
+	// EventsKnown fires when a peer announces events it knows about,
+	// whether via NewEventIDsMsg or an unsolicited EventsStreamResponse.
+	EventsKnown Kind = "events_known"
+
+	// EventsWanted fires when a peer requests events from us
+	// (GetEventsMsg).
+	EventsWanted Kind = "events_wanted"
+)
+
+// CrawlerEvent is one thing that happened to one peer. Only the fields
+// relevant to Kind are populated; the rest are left zero.
+type CrawlerEvent struct {
+	Kind Kind
+	Time time.Time
+
+	Node      *enode.Node
+	Name      string // devp2p client name, when known
+	NetworkID uint64
+
+	Progress *gossip.PeerProgress
+	Verdict  string
+
+	// Latency is the handshake round-trip, for HandshakeOK/HandshakeFailed.
+	Latency time.Duration
+
+	// Err is set for HandshakeFailed, and for a PeerDisconnected that
+	// wasn't a clean shutdown, a HandshakeRejected, a
+	// PeerRegistrationFailed, or a LeechDiagnostic caused by an error.
+	Err error
+
+	// Reason is a short machine-readable tag naming which LeechDiagnostic
+	// occurred (e.g. "timeout", "event_cap").
+	Reason string
+
+	// Count is the number of items involved in a bulk peer message, for
+	// EventsReceived, EventsKnown, and EventsWanted. For a LeechDiagnostic
+	// it's the number of events fetched from the peer so far.
+	Count int
+}
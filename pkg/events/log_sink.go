@@ -0,0 +1,52 @@
+package events
+
+import "github.com/ethereum/go-ethereum/log"
+
+// LogSink writes every CrawlerEvent through go-ethereum's structured
+// log15 logger, at a level appropriate to what happened. It's the
+// closest equivalent to the crawler's old ad-hoc fmt.Printf/p.Log()
+// output, just centralized and consistently formatted.
+type LogSink struct{}
+
+// NewLogSink builds a LogSink. It has no state of its own.
+func NewLogSink() *LogSink {
+	return &LogSink{}
+}
+
+func (LogSink) Emit(evt CrawlerEvent) {
+	ctx := make([]interface{}, 0, 12)
+	if evt.Node != nil {
+		ctx = append(ctx, "node", evt.Node.URLv4())
+	}
+	if evt.Name != "" {
+		ctx = append(ctx, "name", evt.Name)
+	}
+	if evt.NetworkID != 0 {
+		ctx = append(ctx, "network", evt.NetworkID)
+	}
+	if evt.Progress != nil {
+		ctx = append(ctx, "epoch", evt.Progress.Epoch, "block", evt.Progress.LastBlockIdx, "atropos", evt.Progress.LastBlockAtropos)
+	}
+	if evt.Verdict != "" {
+		ctx = append(ctx, "verdict", evt.Verdict)
+	}
+	if evt.Latency != 0 {
+		ctx = append(ctx, "latency", evt.Latency)
+	}
+	if evt.Reason != "" {
+		ctx = append(ctx, "reason", evt.Reason)
+	}
+	if evt.Count != 0 {
+		ctx = append(ctx, "count", evt.Count)
+	}
+
+	switch {
+	case evt.Err != nil:
+		ctx = append(ctx, "err", evt.Err)
+		log.Debug(string(evt.Kind), ctx...)
+	case evt.Kind == VerdictDecided && evt.Verdict == "evil":
+		log.Warn(string(evt.Kind), ctx...)
+	default:
+		log.Info(string(evt.Kind), ctx...)
+	}
+}
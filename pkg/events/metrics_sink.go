@@ -0,0 +1,82 @@
+package events
+
+import (
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/oschwald/geoip2-golang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsSink exports Prometheus counters/histograms derived from the
+// crawler's event stream: peers seen by client name, handshake latency,
+// the verdict distribution, and peer counts by GeoIP country.
+type MetricsSink struct {
+	geoip *geoip2.Reader
+
+	peersByClient    *prometheus.CounterVec
+	handshakeLatency prometheus.Histogram
+	verdicts         *prometheus.CounterVec
+	peersByCountry   *prometheus.CounterVec
+}
+
+// NewMetricsSink registers its metrics with reg and returns a sink ready
+// to Emit. geoipDB may be nil, in which case per-country counts are
+// simply never incremented.
+func NewMetricsSink(reg prometheus.Registerer, geoipDB *geoip2.Reader) *MetricsSink {
+	s := &MetricsSink{
+		geoip: geoipDB,
+
+		peersByClient: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "crawler_peers_by_client_total",
+			Help: "Peers discovered, by advertised devp2p client name.",
+		}, []string{"client"}),
+
+		handshakeLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "crawler_handshake_latency_seconds",
+			Help:    "Time taken to complete the Opera handshake with a peer.",
+			Buckets: prometheus.DefBuckets,
+		}),
+
+		verdicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "crawler_verdicts_total",
+			Help: "Verdicts reached for crawled peers, by verdict.",
+		}, []string{"verdict"}),
+
+		peersByCountry: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "crawler_peers_by_country_total",
+			Help: "Peers discovered, by GeoIP country.",
+		}, []string{"country"}),
+	}
+
+	reg.MustRegister(s.peersByClient, s.handshakeLatency, s.verdicts, s.peersByCountry)
+
+	return s
+}
+
+func (s *MetricsSink) Emit(evt CrawlerEvent) {
+	switch evt.Kind {
+	case PeerDiscovered:
+		s.peersByClient.WithLabelValues(evt.Name).Inc()
+		s.observeCountry(evt.Node)
+
+	case HandshakeOK:
+		s.handshakeLatency.Observe(evt.Latency.Seconds())
+
+	case VerdictDecided:
+		s.verdicts.WithLabelValues(evt.Verdict).Inc()
+	}
+}
+
+func (s *MetricsSink) observeCountry(node *enode.Node) {
+	if s.geoip == nil || node == nil {
+		return
+	}
+	ip := node.IP()
+	if ip == nil {
+		return
+	}
+	rec, err := s.geoip.City(ip)
+	if err != nil {
+		return
+	}
+	s.peersByCountry.WithLabelValues(rec.Country.IsoCode).Inc()
+}
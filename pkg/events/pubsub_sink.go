@@ -0,0 +1,33 @@
+package events
+
+import "encoding/json"
+
+// Publisher is the minimal interface a downstream analytics transport
+// needs to satisfy to receive the crawler's event stream - satisfied by
+// a thin wrapper around a *nats.Conn (Publish(subject, data)) or a Kafka
+// producer, without this package taking on either as a direct
+// dependency.
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// PubSubSink marshals every CrawlerEvent to JSON and republishes it on a
+// fixed subject/topic through pub. It's optional: a crawler with no
+// downstream analytics system configured simply never constructs one.
+type PubSubSink struct {
+	pub     Publisher
+	subject string
+}
+
+// NewPubSubSink builds a sink that publishes to subject through pub.
+func NewPubSubSink(pub Publisher, subject string) *PubSubSink {
+	return &PubSubSink{pub: pub, subject: subject}
+}
+
+func (s *PubSubSink) Emit(evt CrawlerEvent) {
+	data, err := json.Marshal(newJSONLRecord(evt))
+	if err != nil {
+		return
+	}
+	_ = s.pub.Publish(s.subject, data)
+}
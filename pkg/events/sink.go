@@ -0,0 +1,58 @@
+package events
+
+import "github.com/ethereum/go-ethereum/log"
+
+// EventSink receives CrawlerEvents as the crawler observes them. Emit must
+// not block for long - it's called directly from the p2p read loop, so a
+// sink that does real I/O should either be fast (an in-memory counter) or
+// be wrapped in a FanOut, which gives every sink its own queue and drops
+// events rather than stalling the caller.
+type EventSink interface {
+	Emit(evt CrawlerEvent)
+}
+
+// fanOutQueueSize is how many pending events each sink in a FanOut may
+// buffer before new events are dropped for that sink.
+const fanOutQueueSize = 256
+
+// FanOut distributes every event to a fixed set of sinks concurrently.
+// Each sink gets its own bounded queue and drain goroutine, so one slow
+// or stuck sink only drops its own events instead of stalling the others
+// or the p2p read loop that calls Emit.
+type FanOut struct {
+	queues []chan CrawlerEvent
+}
+
+// NewFanOut builds a FanOut over sinks, starting one drain goroutine per
+// sink. With no sinks at all, the returned FanOut silently drops
+// everything - the zero-cost default for a crawler that isn't configured
+// with any.
+func NewFanOut(sinks ...EventSink) *FanOut {
+	f := &FanOut{queues: make([]chan CrawlerEvent, 0, len(sinks))}
+
+	for _, sink := range sinks {
+		sink := sink
+		queue := make(chan CrawlerEvent, fanOutQueueSize)
+		f.queues = append(f.queues, queue)
+
+		go func() {
+			for evt := range queue {
+				sink.Emit(evt)
+			}
+		}()
+	}
+
+	return f
+}
+
+// Emit hands evt to every sink's queue, dropping it for any sink whose
+// queue is currently full rather than blocking the caller.
+func (f *FanOut) Emit(evt CrawlerEvent) {
+	for _, queue := range f.queues {
+		select {
+		case queue <- evt:
+		default:
+			log.Warn("Dropping crawler event, sink queue full", "kind", evt.Kind)
+		}
+	}
+}
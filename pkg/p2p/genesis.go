@@ -1,16 +1,57 @@
 package p2p
 
 import (
+	"fmt"
+
 	"github.com/Fantom-foundation/go-opera/gossip"
 	"github.com/Fantom-foundation/go-opera/inter/iblockproc"
 	"github.com/Fantom-foundation/go-opera/inter/ier"
 	"github.com/Fantom-foundation/go-opera/opera"
 	"github.com/Fantom-foundation/go-opera/opera/genesisstore"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/params"
 )
 
-// LoadGenesis like gossip/Store.ApplyGenesis()
-func (b *ProbeBackend) LoadGenesis(genesis *genesisstore.Store) {
+// networkState is everything a handshake and an ENR entry need to
+// advertise a single Opera network. A ProbeBackend holds one of these per
+// network it's configured to crawl, keyed by NetworkID.
+type networkState struct {
+	NetworkID uint64
+
+	Progress gossip.PeerProgress
+	NodeInfo *gossip.NodeInfo
+	Opera    *opera.Rules
+	Chain    *params.ChainConfig
+	ForkID   forkid.ID
+}
+
+// LoadGenesis loads one Opera genesis, like gossip/Store.ApplyGenesis().
+// The first genesis loaded becomes the backend's primary network, used
+// wherever only a single network makes sense (the trusted oracle, the
+// advertised ENR entry). Call it once per network a single Crawler
+// should cover - mainnet, testnet, or a custom shard.
+func (b *ProbeBackend) LoadGenesis(genesis *genesisstore.Store) error {
+	net, err := buildNetworkState(genesis)
+	if err != nil {
+		return err
+	}
+
+	if b.networks == nil {
+		b.networks = make(map[uint64]*networkState)
+	}
+	if len(b.networks) == 0 {
+		b.primaryNetwork = net.NetworkID
+	}
+	if _, exists := b.networks[net.NetworkID]; exists {
+		return fmt.Errorf("network %d already loaded", net.NetworkID)
+	}
+	b.networks[net.NetworkID] = net
+
+	return nil
+}
+
+func buildNetworkState(genesis *genesisstore.Store) (*networkState, error) {
 	var (
 		g       = genesis.Genesis()
 		hh      []opera.UpgradeHeight
@@ -44,20 +85,56 @@ func (b *ProbeBackend) LoadGenesis(genesis *genesisstore.Store) {
 	})
 
 	if firstES == nil || firstBS == nil {
-		panic("no ERs in genesis")
+		return nil, fmt.Errorf("no ERs in genesis for network %d", g.NetworkID)
 	}
 
-	b.Progress = gossip.PeerProgress{
-		Epoch:            firstES.Epoch,
-		LastBlockIdx:     firstBS.LastBlock.Idx,
-		LastBlockAtropos: firstBS.LastBlock.Atropos,
-	}
-	b.NodeInfo = &gossip.NodeInfo{
+	nodeInfo := &gossip.NodeInfo{
 		Network:     g.NetworkID,
 		Genesis:     common.Hash(g.GenesisID),
 		Epoch:       firstES.Epoch,
 		NumOfBlocks: firstBS.LastBlock.Idx,
 	}
-	b.Opera = &firstES.Rules
-	b.Chain = firstES.Rules.EvmChainConfig(hh)
+	chain := firstES.Rules.EvmChainConfig(hh)
+
+	return &networkState{
+		NetworkID: g.NetworkID,
+		Progress: gossip.PeerProgress{
+			Epoch:            firstES.Epoch,
+			LastBlockIdx:     firstBS.LastBlock.Idx,
+			LastBlockAtropos: firstBS.LastBlock.Atropos,
+		},
+		NodeInfo: nodeInfo,
+		Opera:    &firstES.Rules,
+		Chain:    chain,
+		ForkID:   forkid.NewID(chain, nodeInfo.Genesis, uint64(nodeInfo.NumOfBlocks)),
+	}, nil
+}
+
+// PrimaryNetwork returns the state for the first genesis loaded. It's
+// used wherever only a single network makes sense, such as the trusted
+// oracle or the node's own advertised ENR entry.
+func (b *ProbeBackend) PrimaryNetwork() *networkState {
+	return b.networks[b.primaryNetwork]
+}
+
+// Network returns the state loaded for a given NetworkID, if any.
+func (b *ProbeBackend) Network(id uint64) (*networkState, bool) {
+	net, ok := b.networks[id]
+	return net, ok
+}
+
+// genesisFor returns the networkState p was matched to during handshake,
+// falling back to the primary network for a peer whose network wasn't
+// recorded (e.g. it hasn't handshaked through this backend). It's what a
+// dagLeecher checks fetched events against, since that's the genesis
+// data LoadGenesis actually verified for this peer's network.
+//
+// It returns nil if LoadGenesis has never been called - callers must
+// treat a nil networkState as "no genesis data to check against" rather
+// than dereferencing it.
+func (b *ProbeBackend) genesisFor(p *peer) *networkState {
+	if net, ok := b.Network(b.peerNetwork(p.id)); ok {
+		return net
+	}
+	return b.PrimaryNetwork()
 }
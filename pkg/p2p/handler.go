@@ -0,0 +1,170 @@
+package p2p
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Fantom-foundation/go-opera/gossip"
+	"github.com/Fantom-foundation/go-opera/inter"
+
+	"github.com/ethereum/node-crawler/pkg/common"
+	crawlevents "github.com/ethereum/node-crawler/pkg/events"
+)
+
+// Handler reacts to events observed on a single peer connection and
+// decides what verdict, if any, that peer has earned so far. Registering
+// a different Handler with a ProtocolManager lets the same handshake/
+// dispatch plumbing drive a fork-detector, a tx-flow observer, or a
+// DAG-completeness scanner without forking ProtocolManager.handleMsg.
+//
+// OnProgress, OnEvents, and OnEventStream return one of the Peer*
+// verdict constants, or oracleNoVerdict to leave the peer's current
+// status unchanged.
+type Handler interface {
+	// OnHandshake runs once the p2p/Opera handshake with a peer
+	// succeeds, before any application message is processed, with the
+	// NetworkID the ProtocolManager matched it to. Returning an error
+	// disconnects the peer immediately.
+	OnHandshake(p *peer, networkID uint64) error
+
+	// OnProgress runs whenever a peer reports its PeerProgress.
+	OnProgress(p *peer, progress gossip.PeerProgress) int
+
+	// OnEvents runs when a peer sends us full event payloads (EventsMsg).
+	OnEvents(p *peer, events inter.EventPayloads) int
+
+	// OnEventStream runs for each EventsStreamResponse chunk, including
+	// ones a DAG leecher requested itself.
+	OnEventStream(p *peer, chunk dagChunk) int
+
+	// OnDisconnect runs once, right before the peer is torn down, with
+	// the verdict in effect and why the connection ended (reason is nil
+	// for a clean disconnect).
+	OnDisconnect(p *peer, verdict int, reason error)
+}
+
+// CrawlHandler is the default Handler: it reproduces the crawler's
+// original behavior of cross-checking progress against the trusted
+// oracle, leeching evidence from suspicious peers, and emitting a
+// verdict to the backend's output channel once one is reached.
+type CrawlHandler struct {
+	backend *ProbeBackend
+}
+
+// NewCrawlHandler builds the default Handler, wired to backend's oracle,
+// leecher registry, and output channel.
+func NewCrawlHandler(backend *ProbeBackend) *CrawlHandler {
+	return &CrawlHandler{backend: backend}
+}
+
+func (h *CrawlHandler) OnHandshake(p *peer, networkID uint64) error {
+	h.backend.setPeerNetwork(p.id, networkID)
+	return nil
+}
+
+func (h *CrawlHandler) OnProgress(p *peer, progress gossip.PeerProgress) int {
+	b := h.backend
+
+	verdict := oracleNoVerdict
+	if b.oracle != nil {
+		verdict = b.oracle.Judge(progress.LastBlockIdx, progress.LastBlockAtropos)
+	}
+
+	switch verdict {
+	case PeerHonest:
+		return PeerHonest
+	case PeerEvil:
+		// already confirmed by the trusted quorum - no need to leech
+		return PeerEvil
+	}
+
+	if progress.Epoch <= progress.LastBlockAtropos.Epoch() {
+		return PeerUseless
+	}
+
+	if b.leeching(p.id) {
+		// Already fetching this peer's DAG from an earlier ProgressMsg -
+		// Opera peers routinely send more than one while being leeched,
+		// so don't start a second leecher racing the first.
+		return PeerFetching
+	}
+
+	// The peer's own progress report looked inconsistent, and the
+	// trusted quorum doesn't have an opinion yet. Don't just take its
+	// word for it - fetch a bounded window of its DAG and check it
+	// against the genesis rules before passing final judgement.
+	leecher := b.startDagLeecher(p, progress.Epoch)
+	leecher.Start()
+	b.sink.Emit(crawlevents.CrawlerEvent{
+		Kind: crawlevents.LeechStarted, Time: time.Now(),
+		Node: p.Node(), Progress: &progress,
+	})
+	return PeerFetching
+}
+
+func (h *CrawlHandler) OnEvents(p *peer, events inter.EventPayloads) int {
+	h.backend.sink.Emit(crawlevents.CrawlerEvent{
+		Kind: crawlevents.EventsReceived, Time: time.Now(),
+		Node: p.Node(), Count: len(events),
+	})
+	return oracleNoVerdict
+}
+
+func (h *CrawlHandler) OnEventStream(p *peer, chunk dagChunk) int {
+	b := h.backend
+
+	b.leechersMu.Lock()
+	leecher := b.leechers[p.id]
+	b.leechersMu.Unlock()
+
+	if leecher != nil {
+		// This peer is being actively leeched - hand the chunk to its
+		// state machine instead of just logging it.
+		leecher.deliverChunk(chunk)
+		return oracleNoVerdict
+	}
+
+	if len(chunk.IDs) > 0 {
+		b.sink.Emit(crawlevents.CrawlerEvent{
+			Kind: crawlevents.EventsKnown, Time: time.Now(),
+			Node: p.Node(), Count: len(chunk.IDs),
+		})
+	}
+	if len(chunk.Events) > 0 {
+		b.sink.Emit(crawlevents.CrawlerEvent{
+			Kind: crawlevents.EventsKnown, Time: time.Now(),
+			Node: p.Node(), Count: len(chunk.Events),
+		})
+		return PeerUseless
+	}
+
+	return oracleNoVerdict
+}
+
+func (h *CrawlHandler) OnDisconnect(p *peer, verdict int, reason error) {
+	networkID := h.backend.peerNetwork(p.id)
+	h.backend.dropPeerNetwork(p.id)
+
+	h.backend.output <- &common.NodeJSON{
+		N: p.Node(),
+		Info: &common.ClientInfo{
+			Blockheight: strconv.FormatUint(uint64(p.progress.LastBlockIdx), 10),
+		},
+		Verdict:   verdictName(verdict),
+		Progress:  &p.progress,
+		NetworkID: networkID,
+	}
+}
+
+func verdictName(v int) string {
+	switch v {
+	case PeerHonest:
+		return "honest"
+	case PeerEvil:
+		return "evil"
+	case PeerUseless:
+		return "useless"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,170 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Fantom-foundation/go-opera/gossip"
+	"github.com/Fantom-foundation/lachesis-base/hash"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+
+	"github.com/ethereum/node-crawler/pkg/common"
+)
+
+// mockMsgReadWriter lets tests drive Handler methods without a real
+// network connection.
+type mockMsgReadWriter struct {
+	in chan p2p.Msg
+}
+
+func newMockMsgReadWriter() *mockMsgReadWriter {
+	return &mockMsgReadWriter{in: make(chan p2p.Msg, 8)}
+}
+
+func (m *mockMsgReadWriter) ReadMsg() (p2p.Msg, error) {
+	return <-m.in, nil
+}
+
+func (m *mockMsgReadWriter) WriteMsg(p2p.Msg) error {
+	return nil
+}
+
+func testPeer(rw p2p.MsgReadWriter) *peer {
+	raw := p2p.NewPeer(enode.ID{}, "test", nil)
+	return newPeer(gossip.FTM63, raw, rw)
+}
+
+func TestCrawlHandlerOnEventStreamUnsolicited(t *testing.T) {
+	backend := NewProbeBackend(make(chan *common.NodeJSON, 1), nil)
+	h := NewCrawlHandler(backend)
+	p := testPeer(newMockMsgReadWriter())
+
+	if verdict := h.OnEventStream(p, dagChunk{}); verdict != oracleNoVerdict {
+		t.Fatalf("expected no verdict for an empty, unsolicited chunk, got %d", verdict)
+	}
+}
+
+func TestCrawlHandlerOnEventStreamRoutesToLeecher(t *testing.T) {
+	backend := NewProbeBackend(make(chan *common.NodeJSON, 1), nil)
+	backend.pm = &ProtocolManager{quitSync: make(chan struct{})}
+	h := NewCrawlHandler(backend)
+	p := testPeer(newMockMsgReadWriter())
+
+	leecher := backend.startDagLeecher(p, 0)
+	defer leecher.forget()
+
+	chunk := dagChunk{IDs: nil}
+	if verdict := h.OnEventStream(p, chunk); verdict != oracleNoVerdict {
+		t.Fatalf("expected no verdict while a leecher owns the peer, got %d", verdict)
+	}
+}
+
+func TestCrawlHandlerOnHandshakeRecordsPeerNetwork(t *testing.T) {
+	backend := NewProbeBackend(make(chan *common.NodeJSON, 1), nil)
+	h := NewCrawlHandler(backend)
+	p := testPeer(newMockMsgReadWriter())
+
+	if err := h.OnHandshake(p, 42); err != nil {
+		t.Fatalf("OnHandshake: %v", err)
+	}
+	if got := backend.peerNetwork(p.id); got != 42 {
+		t.Fatalf("peerNetwork(%q) = %d, want 42", p.id, got)
+	}
+}
+
+func TestCrawlHandlerOnProgressUselessWhenBehindOwnAtropos(t *testing.T) {
+	backend := NewProbeBackend(make(chan *common.NodeJSON, 1), nil)
+	h := NewCrawlHandler(backend)
+	p := testPeer(newMockMsgReadWriter())
+
+	progress := gossip.PeerProgress{Epoch: 0, LastBlockAtropos: hash.Event{}}
+	if verdict := h.OnProgress(p, progress); verdict != PeerUseless {
+		t.Fatalf("expected PeerUseless, got %d", verdict)
+	}
+}
+
+func TestCrawlHandlerOnProgressFollowsTrustedOracle(t *testing.T) {
+	backend := NewProbeBackend(make(chan *common.NodeJSON, 1), nil)
+	h := NewCrawlHandler(backend)
+	p := testPeer(newMockMsgReadWriter())
+
+	atropos := hash.Event{1}
+	progress := gossip.PeerProgress{Epoch: 5, LastBlockIdx: 100, LastBlockAtropos: atropos}
+
+	backend.oracle = &TrustedOracle{
+		minFraction: 50,
+		views: map[enode.ID]*trustedView{
+			{1}: {
+				history: []heightReport{{height: progress.LastBlockIdx, atropos: atropos}},
+				seenAt:  time.Now(),
+			},
+		},
+	}
+
+	if verdict := h.OnProgress(p, progress); verdict != PeerHonest {
+		t.Fatalf("expected the trusted oracle's PeerHonest verdict, got %d", verdict)
+	}
+}
+
+func TestCrawlHandlerOnProgressDoesNotDuplicateLeecher(t *testing.T) {
+	backend := NewProbeBackend(make(chan *common.NodeJSON, 1), nil)
+	h := NewCrawlHandler(backend)
+	p := testPeer(newMockMsgReadWriter())
+
+	existing := backend.startDagLeecher(p, 1)
+	defer existing.forget()
+
+	progress := gossip.PeerProgress{Epoch: 1, LastBlockAtropos: hash.Event{}}
+	if verdict := h.OnProgress(p, progress); verdict != PeerFetching {
+		t.Fatalf("expected PeerFetching, got %d", verdict)
+	}
+
+	backend.leechersMu.Lock()
+	got := backend.leechers[p.id]
+	backend.leechersMu.Unlock()
+	if got != existing {
+		t.Fatalf("OnProgress replaced the in-flight leecher instead of reusing it")
+	}
+}
+
+func TestCrawlHandlerOnDisconnectEmitsVerdict(t *testing.T) {
+	nodes := make(chan *common.NodeJSON, 1)
+	backend := NewProbeBackend(nodes, nil)
+	h := NewCrawlHandler(backend)
+	p := testPeer(newMockMsgReadWriter())
+
+	backend.setPeerNetwork(p.id, 7)
+
+	h.OnDisconnect(p, PeerHonest, nil)
+
+	select {
+	case n := <-nodes:
+		if n.Verdict != "honest" {
+			t.Fatalf("Verdict = %q, want %q", n.Verdict, "honest")
+		}
+		if n.NetworkID != 7 {
+			t.Fatalf("NetworkID = %d, want 7", n.NetworkID)
+		}
+	default:
+		t.Fatal("expected OnDisconnect to emit a NodeJSON")
+	}
+
+	if got := backend.peerNetwork(p.id); got != 0 {
+		t.Fatalf("expected peer network to be dropped after disconnect, still got %d", got)
+	}
+}
+
+func TestVerdictName(t *testing.T) {
+	cases := map[int]string{
+		PeerHonest:  "honest",
+		PeerEvil:    "evil",
+		PeerUseless: "useless",
+		PeerUnknown: "unknown",
+	}
+	for verdict, want := range cases {
+		if got := verdictName(verdict); got != want {
+			t.Errorf("verdictName(%d) = %q, want %q", verdict, got, want)
+		}
+	}
+}
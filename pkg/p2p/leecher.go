@@ -0,0 +1,299 @@
+package p2p
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Fantom-foundation/go-opera/gossip"
+	"github.com/Fantom-foundation/go-opera/inter"
+	"github.com/Fantom-foundation/lachesis-base/hash"
+	"github.com/Fantom-foundation/lachesis-base/inter/idx"
+
+	crawlevents "github.com/ethereum/node-crawler/pkg/events"
+)
+
+// Additional peer verdicts, produced once the DAG leecher below has
+// gathered enough evidence to decide whether a peer is telling the truth
+// about the chain it claims to follow. These extend the PeerUseless/
+// PeerEvil status values used for the cheap, handshake-only checks.
+const (
+	PeerFetching = iota + 100
+	PeerHonest
+	PeerUnknown
+)
+
+const (
+	// leecherMaxEvents caps the total number of events fetched from a
+	// single peer, so a chatty or malicious peer can't be used to run us
+	// out of memory.
+	leecherMaxEvents = 5000
+
+	// leecherWindowSize is the number of events requested per
+	// RequestEventsStream round trip.
+	leecherWindowSize = 256
+)
+
+// leecherRequestTimeout bounds how long we wait for a single
+// EventsStreamResponse chunk before giving up on the peer. It's a var,
+// not a const, so tests can shrink it instead of waiting out the real
+// timeout.
+var leecherRequestTimeout = 10 * time.Second
+
+// dagLeecher fetches a bounded window of DAG events from a peer, starting
+// at the epoch the peer itself reported, and checks that what comes back
+// is internally consistent with the genesis rules loaded into the
+// backend. It exists to turn a cheap, self-reported PeerProgress into a
+// verdict backed by actual chain data.
+type dagLeecher struct {
+	backend *ProbeBackend
+	peer    *peer
+
+	epoch idx.Epoch
+	// genesisEpoch is the earliest epoch the genesis loaded for this
+	// peer's network actually covers (networkState.Progress.Epoch, set
+	// by LoadGenesis) - the one boundary below which an unknown parent
+	// can be trusted without having been fetched ourselves. Unlike
+	// epoch, it isn't self-reported by the peer.
+	genesisEpoch idx.Epoch
+	known        map[hash.Event]struct{}
+	fetched      int
+
+	chunks  chan dagChunk
+	quit    chan struct{}
+	done    chan struct{}
+	verdict int
+}
+
+// startDagLeecher builds a leecher for p, starting at epoch. It does not
+// send anything on the wire until Start is called.
+func (b *ProbeBackend) startDagLeecher(p *peer, epoch idx.Epoch) *dagLeecher {
+	l := &dagLeecher{
+		backend:      b,
+		peer:         p,
+		epoch:        epoch,
+		genesisEpoch: genesisEpochFor(b, p),
+		known:        make(map[hash.Event]struct{}),
+		chunks:       make(chan dagChunk, 4),
+		quit:         make(chan struct{}),
+		done:         make(chan struct{}),
+		verdict:      PeerUnknown,
+	}
+
+	b.leechersMu.Lock()
+	if b.leechers == nil {
+		b.leechers = make(map[string]*dagLeecher)
+	}
+	b.leechers[p.id] = l
+	b.leechersMu.Unlock()
+
+	return l
+}
+
+// genesisEpochFor reports the earliest epoch b.genesisFor(p) actually
+// covers, defaulting to epoch 0 if no genesis has been loaded for p's
+// network (or at all). Epoch 0 is the fail-closed choice: with nothing
+// loaded to check against, no unknown parent can be trusted as
+// predating genesis, so verifyLinkage rejects them all instead of
+// panicking on a nil networkState.
+func genesisEpochFor(b *ProbeBackend, p *peer) idx.Epoch {
+	net := b.genesisFor(p)
+	if net == nil {
+		return 0
+	}
+	return net.Progress.Epoch
+}
+
+// leeching reports whether a DAG leecher is already in flight for id, so
+// a second ProgressMsg from the same peer while one is running doesn't
+// spawn a competing leecher that races it for peer.Status and orphans
+// the first one's in-flight request.
+func (b *ProbeBackend) leeching(id string) bool {
+	b.leechersMu.Lock()
+	_, ok := b.leechers[id]
+	b.leechersMu.Unlock()
+	return ok
+}
+
+// Start requests the first window of events and runs the verification
+// loop until a verdict is reached, the peer times out, quitSync fires, or
+// leecherMaxEvents is hit. The final verdict is written back onto the
+// peer's Status so the regular handle() loop picks it up on its next
+// pass, the same way the cheap handshake-only checks do.
+func (l *dagLeecher) Start() {
+	l.backend.pm.wg.Add(1)
+	go func() {
+		defer l.backend.pm.wg.Done()
+		defer close(l.done)
+		defer l.forget()
+
+		l.verdict = l.run()
+		l.peer.Status = l.verdict
+	}()
+}
+
+// Stop cancels an in-flight leech early, e.g. because the peer is
+// disconnecting. It is safe to call more than once.
+func (l *dagLeecher) Stop() {
+	select {
+	case <-l.quit:
+	default:
+		close(l.quit)
+	}
+	<-l.done
+}
+
+func (l *dagLeecher) forget() {
+	l.backend.leechersMu.Lock()
+	delete(l.backend.leechers, l.peer.id)
+	l.backend.leechersMu.Unlock()
+}
+
+func (l *dagLeecher) run() int {
+	if err := l.request(l.epoch); err != nil {
+		l.emitDiagnostic("request_failed", err)
+		return PeerUnknown
+	}
+
+	timeout := time.NewTimer(leecherRequestTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case chunk := <-l.chunks:
+			verdict, done, err := l.verify(chunk)
+			if err != nil {
+				l.emitDiagnostic("verify_failed", err)
+				return PeerEvil
+			}
+			if done {
+				return verdict
+			}
+
+			if _, capped := l.fetchStatus(); capped {
+				l.emitDiagnostic("event_cap", nil)
+				return PeerUnknown
+			}
+
+			if !timeout.Stop() {
+				<-timeout.C
+			}
+			timeout.Reset(leecherRequestTimeout)
+
+		case <-timeout.C:
+			l.emitDiagnostic("timeout", nil)
+			return PeerUnknown
+
+		case <-l.quit:
+			return PeerUnknown
+
+		case <-l.backend.pm.quitSync:
+			return PeerUnknown
+		}
+	}
+}
+
+// emitDiagnostic reports an internal DAG-leech occurrence that isn't
+// itself a verdict - a failed request, a failed verification, the fetch
+// cap, or a timeout - on the backend's EventSink instead of only a
+// debug-level log line.
+func (l *dagLeecher) emitDiagnostic(reason string, err error) {
+	l.backend.sink.Emit(crawlevents.CrawlerEvent{
+		Kind: crawlevents.LeechDiagnostic, Time: time.Now(),
+		Node: l.peer.Node(), Reason: reason, Count: l.fetched, Err: err,
+	})
+}
+
+// request asks the peer for the next window of events, starting at epoch.
+func (l *dagLeecher) request(epoch idx.Epoch) error {
+	return gossip.Send(l.peer.rw, gossip.RequestEventsStream, gossip.EventsStreamRequest{
+		Epoch: epoch,
+		Limit: leecherWindowSize,
+	})
+}
+
+// deliverChunk is called from handleMsg when an EventsStreamResponse
+// arrives for this peer while it's being leeched.
+func (l *dagLeecher) deliverChunk(chunk dagChunk) {
+	select {
+	case l.chunks <- chunk:
+	case <-l.quit:
+	case <-l.backend.pm.quitSync:
+	}
+}
+
+// verify checks a single chunk of events against parent linkage and the
+// genesis rules, and decides whether enough evidence has been gathered to
+// stop. It returns the verdict so far and whether the leech is complete.
+func (l *dagLeecher) verify(chunk dagChunk) (verdict int, done bool, err error) {
+	if len(chunk.Events) == 0 && len(chunk.IDs) == 0 {
+		// Peer has nothing more to offer for this window; that's not
+		// itself evidence of dishonesty.
+		return PeerUnknown, true, nil
+	}
+
+	for _, e := range chunk.Events {
+		if err := l.verifyEvent(e); err != nil {
+			return PeerEvil, true, fmt.Errorf("event %s: %w", e.ID(), err)
+		}
+		l.known[e.ID()] = struct{}{}
+	}
+
+	l.fetched += len(chunk.Events)
+
+	if windowFull, _ := l.fetchStatus(); windowFull {
+		// We've seen a consistent window of real, signed, correctly
+		// linked DAG events rooted in the genesis rules we loaded -
+		// that's strong evidence the peer is honest.
+		return PeerHonest, true, nil
+	}
+
+	return PeerUnknown, false, nil
+}
+
+// fetchStatus reports whether the leech has gathered a full, consistent
+// window of events (windowFull, the point at which run() can stop and
+// call the peer honest) or has hit the total event cap (capped, the
+// point at which run() gives up instead of leeching forever).
+func (l *dagLeecher) fetchStatus() (windowFull, capped bool) {
+	return l.fetched >= leecherWindowSize, l.fetched >= leecherMaxEvents
+}
+
+// verifyEvent checks the event's signature and that its parents are
+// either already-seen events from this leech or part of the genesis
+// state, per the rules loaded by LoadGenesis.
+func (l *dagLeecher) verifyEvent(e *inter.EventPayload) error {
+	if err := e.VerifySig(); err != nil {
+		return fmt.Errorf("bad signature: %w", err)
+	}
+	return l.verifyLinkage(e.Epoch(), e.Parents())
+}
+
+// verifyLinkage checks that an event's epoch is at most one past the
+// epoch this leech requested (earlier epochs are not rejected), and that any parent we haven't fetched ourselves
+// predates genesisEpoch. It's split out from verifyEvent so the
+// epoch/parent-linkage rules - the part that was wrong once already,
+// when it trusted the peer's self-reported epoch instead of genesisEpoch
+// - can be tested without needing a signed *inter.EventPayload.
+func (l *dagLeecher) verifyLinkage(epoch idx.Epoch, parents hash.Events) error {
+	if epoch > l.epoch+1 {
+		return fmt.Errorf("event from epoch %d, expected <= %d", epoch, l.epoch+1)
+	}
+
+	for _, p := range parents {
+		if _, ok := l.known[p]; ok {
+			continue
+		}
+		// A parent we haven't fetched ourselves is only acceptable if
+		// it predates genesisEpoch, the earliest epoch LoadGenesis
+		// actually verified for this network - not merely l.epoch, the
+		// epoch the peer itself reported. Accepting anything below a
+		// self-reported epoch would let a peer fabricate a whole
+		// mini-DAG rooted at made-up parent hashes, by simply reporting
+		// whatever epoch makes its invented history "predate" it.
+		if epoch >= l.genesisEpoch {
+			return fmt.Errorf("unknown parent %s at or after genesis epoch %d", p, l.genesisEpoch)
+		}
+	}
+
+	return nil
+}
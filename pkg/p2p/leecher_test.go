@@ -0,0 +1,123 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Fantom-foundation/lachesis-base/hash"
+
+	"github.com/ethereum/node-crawler/pkg/common"
+)
+
+func TestDagLeecherVerifyLinkageAcceptsKnownParent(t *testing.T) {
+	parent := hash.Event{1}
+	l := &dagLeecher{epoch: 5, genesisEpoch: 3, known: map[hash.Event]struct{}{parent: {}}}
+
+	if err := l.verifyLinkage(5, hash.Events{parent}); err != nil {
+		t.Fatalf("expected an already-fetched parent to be accepted regardless of epoch, got %v", err)
+	}
+}
+
+func TestDagLeecherVerifyLinkageAcceptsUnknownParentBeforeGenesis(t *testing.T) {
+	l := &dagLeecher{epoch: 5, genesisEpoch: 3, known: map[hash.Event]struct{}{}}
+
+	if err := l.verifyLinkage(2, hash.Events{{1}}); err != nil {
+		t.Fatalf("expected an unknown parent before genesisEpoch to be accepted, got %v", err)
+	}
+}
+
+func TestDagLeecherVerifyLinkageRejectsUnknownParentAtGenesisEpoch(t *testing.T) {
+	l := &dagLeecher{epoch: 5, genesisEpoch: 3, known: map[hash.Event]struct{}{}}
+
+	if err := l.verifyLinkage(3, hash.Events{{1}}); err == nil {
+		t.Fatal("expected an unknown parent at genesisEpoch to be rejected")
+	}
+}
+
+func TestDagLeecherVerifyLinkageRejectsUnknownParentAfterGenesisEpoch(t *testing.T) {
+	l := &dagLeecher{epoch: 5, genesisEpoch: 3, known: map[hash.Event]struct{}{}}
+
+	if err := l.verifyLinkage(4, hash.Events{{1}}); err == nil {
+		t.Fatal("expected an unknown parent after genesisEpoch to be rejected")
+	}
+}
+
+func TestDagLeecherVerifyLinkageRejectsEventTooFarAhead(t *testing.T) {
+	l := &dagLeecher{epoch: 5, genesisEpoch: 3, known: map[hash.Event]struct{}{}}
+
+	if err := l.verifyLinkage(7, nil); err == nil {
+		t.Fatal("expected an event two epochs ahead of the requested one to be rejected")
+	}
+}
+
+func TestDagLeecherFetchStatusWindowAndCap(t *testing.T) {
+	l := &dagLeecher{fetched: leecherWindowSize - 1}
+	if windowFull, capped := l.fetchStatus(); windowFull || capped {
+		t.Fatalf("expected neither cutoff before leecherWindowSize, got windowFull=%v capped=%v", windowFull, capped)
+	}
+
+	l.fetched = leecherWindowSize
+	if windowFull, capped := l.fetchStatus(); !windowFull || capped {
+		t.Fatalf("expected only windowFull at leecherWindowSize, got windowFull=%v capped=%v", windowFull, capped)
+	}
+
+	l.fetched = leecherMaxEvents
+	if windowFull, capped := l.fetchStatus(); !windowFull || !capped {
+		t.Fatalf("expected both cutoffs at leecherMaxEvents, got windowFull=%v capped=%v", windowFull, capped)
+	}
+}
+
+func TestDagLeecherVerifyEmptyChunkIsNotDishonest(t *testing.T) {
+	l := &dagLeecher{known: map[hash.Event]struct{}{}}
+
+	verdict, done, err := l.verify(dagChunk{})
+	if err != nil || !done || verdict != PeerUnknown {
+		t.Fatalf("verify(empty) = (%d, %v, %v), want (PeerUnknown, true, nil)", verdict, done, err)
+	}
+}
+
+func TestDagLeecherRunQuit(t *testing.T) {
+	backend := NewProbeBackend(make(chan *common.NodeJSON, 1), nil)
+	backend.pm = &ProtocolManager{quitSync: make(chan struct{})}
+	p := testPeer(newMockMsgReadWriter())
+
+	l := backend.startDagLeecher(p, 1)
+	defer l.forget()
+	close(l.quit)
+
+	if got := l.run(); got != PeerUnknown {
+		t.Fatalf("run() on a cancelled leech = %d, want PeerUnknown", got)
+	}
+}
+
+func TestDagLeecherRunQuitSync(t *testing.T) {
+	backend := NewProbeBackend(make(chan *common.NodeJSON, 1), nil)
+	pm := &ProtocolManager{quitSync: make(chan struct{})}
+	backend.pm = pm
+	p := testPeer(newMockMsgReadWriter())
+
+	l := backend.startDagLeecher(p, 1)
+	defer l.forget()
+	close(pm.quitSync)
+
+	if got := l.run(); got != PeerUnknown {
+		t.Fatalf("run() after quitSync fired = %d, want PeerUnknown", got)
+	}
+}
+
+func TestDagLeecherRunTimeout(t *testing.T) {
+	orig := leecherRequestTimeout
+	leecherRequestTimeout = time.Millisecond
+	defer func() { leecherRequestTimeout = orig }()
+
+	backend := NewProbeBackend(make(chan *common.NodeJSON, 1), nil)
+	backend.pm = &ProtocolManager{quitSync: make(chan struct{})}
+	p := testPeer(newMockMsgReadWriter())
+
+	l := backend.startDagLeecher(p, 1)
+	defer l.forget()
+
+	if got := l.run(); got != PeerUnknown {
+		t.Fatalf("run() on a request that never gets a chunk = %d, want PeerUnknown", got)
+	}
+}
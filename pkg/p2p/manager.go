@@ -0,0 +1,421 @@
+package p2p
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fantom-foundation/go-opera/gossip"
+	"github.com/Fantom-foundation/go-opera/inter"
+	"github.com/Fantom-foundation/lachesis-base/hash"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover/discfilter"
+	"github.com/ethereum/go-ethereum/p2p/dnsdisc"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	crawlevents "github.com/ethereum/node-crawler/pkg/events"
+)
+
+// protocolLengths are the number of implemented message corresponding to different protocol versions.
+// TODO: make gossip.protocolLengths public instead.
+var gossipProtocolLengths = map[uint]uint64{gossip.FTM62: gossip.EventsStreamResponse + 1, gossip.FTM63: gossip.EPsStreamResponse + 1}
+
+// ProtocolManager owns everything about running the Opera gossip protocol
+// against many peers at once: registering it with go-ethereum's p2p
+// layer, handshaking, tracking the live peer set, and dispatching inbound
+// messages. It deliberately doesn't know what to do with any of that -
+// that's entirely up to the Handler it's built with, so a fork-detector,
+// a tx-flow observer, or a DAG-completeness scanner can all reuse this
+// plumbing without forking handleMsg.
+//
+// It can be configured with more than one Opera network at once: each
+// peer's advertised ENR fork ID is matched against the known networks
+// before the handshake, and that network's NodeInfo/Progress/genesis is
+// what gets offered to it. Peers that don't match any known network fall
+// back to the primary one, same as a single-network manager.
+type ProtocolManager struct {
+	networks map[uint64]*networkState
+	primary  uint64
+	enr      enr.Entry
+
+	peers   *peerSet
+	handler Handler
+	sink    crawlevents.EventSink
+
+	wg       sync.WaitGroup
+	quitSync chan struct{}
+}
+
+// NewProtocolManager builds a manager that will handshake against one of
+// the given networks (matched per-peer by ENR fork ID, falling back to
+// primary), hand every peer event to handler, and emit a CrawlerEvent for
+// each peer-lifecycle occurrence to sink.
+func NewProtocolManager(handler Handler, networks map[uint64]*networkState, primary uint64, sink crawlevents.EventSink) *ProtocolManager {
+	primaryNet := networks[primary]
+
+	return &ProtocolManager{
+		networks: networks,
+		primary:  primary,
+		enr:      currentENREntry(primaryNet.NodeInfo, primaryNet.Chain),
+
+		peers:   newPeerSet(),
+		handler: handler,
+		sink:    sink,
+
+		quitSync: make(chan struct{}),
+	}
+}
+
+// networkFor picks which configured network to treat n as belonging to,
+// by matching its advertised ENR fork ID entry. It falls back to the
+// primary network when n doesn't advertise one, or advertises one that
+// doesn't match anything we're configured for.
+func (pm *ProtocolManager) networkFor(n *enode.Node) *networkState {
+	var entry enrEntry
+	if err := n.Load(&entry); err == nil {
+		for _, net := range pm.networks {
+			if net.ForkID.Hash == entry.ForkID.Hash {
+				return net
+			}
+		}
+	}
+	return pm.networks[pm.primary]
+}
+
+// Close stops accepting new peers and waits for every in-flight handle()
+// call to return.
+func (pm *ProtocolManager) Close() {
+	close(pm.quitSync)
+	pm.wg.Wait()
+}
+
+// Protocols builds the go-ethereum p2p.Protocol set this manager drives.
+func (pm *ProtocolManager) Protocols() []p2p.Protocol {
+	protocols := make([]p2p.Protocol, len(gossip.ProtocolVersions))
+	for i, version := range gossip.ProtocolVersions {
+		version := version // closure
+
+		protocols[i] = p2p.Protocol{
+			Name:    gossip.ProtocolName,
+			Version: version,
+			Length:  gossipProtocolLengths[version],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				peer := newPeer(version, p, rw)
+				defer peer.Close()
+
+				select {
+				case <-pm.quitSync:
+					return p2p.DiscQuitting
+				default:
+					pm.wg.Add(1)
+					defer pm.wg.Done()
+					return pm.handle(peer)
+				}
+			},
+			NodeInfo: func() interface{} {
+				return pm.networks[pm.primary].NodeInfo
+			},
+			PeerInfo: func(id enode.ID) interface{} {
+				if p := pm.peers.Peer(id.String()); p != nil {
+					return p.Info()
+				}
+				return nil
+			},
+			Attributes:     []enr.Entry{pm.enr},
+			DialCandidates: operaDialCandidates(),
+		}
+	}
+
+	return protocols
+}
+
+func (pm *ProtocolManager) handle(p *peer) error {
+	defer p.Disconnect(p2p.DiscUselessPeer)
+	// defer discfilter.Ban(p.ID()) // don't connect again
+
+	pm.sink.Emit(crawlevents.CrawlerEvent{
+		Kind: crawlevents.PeerDiscovered,
+		Time: time.Now(),
+		Node: p.Node(),
+		Name: p.Fullname(),
+	})
+
+	// Check useless
+	useless := discfilter.Banned(p.Node().ID(), p.Node().Record())
+	if !strings.Contains(strings.ToLower(p.Name()), "opera") {
+		useless = true
+	}
+	if !p.Peer.Info().Network.Trusted && useless {
+		return p2p.DiscUselessPeer
+	}
+
+	// Execute the handshake, offering whichever configured network this
+	// peer's advertised ENR fork ID matches (or the primary, if none do).
+	net := pm.networkFor(p.Node())
+
+	start := time.Now()
+	err := p.Handshake(net.NodeInfo.Network, net.Progress, net.NodeInfo.Genesis)
+	latency := time.Since(start)
+
+	if err != nil {
+		pm.sink.Emit(crawlevents.CrawlerEvent{
+			Kind: crawlevents.HandshakeFailed, Time: time.Now(),
+			Node: p.Node(), Name: p.Fullname(), NetworkID: net.NetworkID,
+			Latency: latency, Err: err,
+		})
+		return err
+	}
+	pm.sink.Emit(crawlevents.CrawlerEvent{
+		Kind: crawlevents.HandshakeOK, Time: time.Now(),
+		Node: p.Node(), Name: p.Fullname(), NetworkID: net.NetworkID,
+		Latency: latency,
+	})
+
+	if err := pm.handler.OnHandshake(p, net.NetworkID); err != nil {
+		pm.sink.Emit(crawlevents.CrawlerEvent{
+			Kind: crawlevents.HandshakeRejected, Time: time.Now(),
+			Node: p.Node(), Name: p.Fullname(), NetworkID: net.NetworkID, Err: err,
+		})
+		return err
+	}
+
+	// Register the peer locally
+	if err := pm.peers.RegisterPeer(p); err != nil {
+		pm.sink.Emit(crawlevents.CrawlerEvent{
+			Kind: crawlevents.PeerRegistrationFailed, Time: time.Now(),
+			Node: p.Node(), Name: p.Fullname(), NetworkID: net.NetworkID, Err: err,
+		})
+		// OnHandshake already ran and may have recorded per-peer state
+		// (e.g. setPeerNetwork) - let the handler tear that down even
+		// though we never reach the main handling loop below.
+		pm.handler.OnDisconnect(p, p.Status, err)
+		return err
+	}
+	defer pm.unregisterPeer(p.id)
+
+	// Handle incoming messages until the connection is torn down, or the
+	// handler decides a verdict has been reached.
+	for {
+		err := pm.handleMsg(p)
+		if err != nil {
+			pm.disconnect(p, net.NetworkID, p.Status, err)
+			pm.handler.OnDisconnect(p, p.Status, err)
+			return err
+		}
+
+		switch p.Status {
+		case PeerUseless, PeerEvil, PeerHonest, PeerUnknown:
+			pm.disconnect(p, net.NetworkID, p.Status, nil)
+			pm.handler.OnDisconnect(p, p.Status, nil)
+			return nil
+		default:
+			// Non-terminal status (e.g. PeerFetching) - keep reading.
+		}
+	}
+}
+
+// disconnect emits the VerdictDecided and PeerDisconnected events for a
+// peer connection that's about to end, with verdict in effect and why
+// (reason is nil for a clean disconnect).
+func (pm *ProtocolManager) disconnect(p *peer, networkID uint64, verdict int, reason error) {
+	pm.sink.Emit(crawlevents.CrawlerEvent{
+		Kind: crawlevents.VerdictDecided, Time: time.Now(),
+		Node: p.Node(), NetworkID: networkID, Verdict: verdictName(verdict),
+	})
+	pm.sink.Emit(crawlevents.CrawlerEvent{
+		Kind: crawlevents.PeerDisconnected, Time: time.Now(),
+		Node: p.Node(), NetworkID: networkID, Verdict: verdictName(verdict), Err: reason,
+	})
+}
+
+// handleMsg is invoked whenever an inbound message is received from a remote
+// peer. The remote connection is torn down upon returning any error.
+func (pm *ProtocolManager) handleMsg(p *peer) error {
+	// Read the next message from the remote peer, and ensure it's fully consumed
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > protocolMaxMsgSize {
+		return errResp(gossip.ErrMsgTooLarge, "%v > %v", msg.Size, protocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	// Handle the message depending on its contents
+	switch {
+	case msg.Code == gossip.HandshakeMsg:
+		// Status messages should never arrive after the handshake
+		return errResp(gossip.ErrExtraStatusMsg, "uncontrolled status message")
+
+	case msg.Code == gossip.ProgressMsg:
+		var progress gossip.PeerProgress
+		if err := msg.Decode(&progress); err != nil {
+			return errResp(gossip.ErrDecode, "%v: %v", msg, err)
+		}
+		p.progress = progress
+		pm.sink.Emit(crawlevents.CrawlerEvent{
+			Kind: crawlevents.ProgressObserved, Time: time.Now(),
+			Node: p.Node(), NetworkID: pm.networkFor(p.Node()).NetworkID, Progress: &progress,
+		})
+
+		if verdict := pm.handler.OnProgress(p, progress); verdict != oracleNoVerdict {
+			p.Status = verdict
+		}
+
+	case msg.Code == gossip.EvmTxsMsg:
+		break
+
+	case msg.Code == gossip.NewEvmTxHashesMsg:
+		break
+
+	case msg.Code == gossip.GetEvmTxsMsg:
+		break
+
+	case msg.Code == gossip.EventsMsg:
+		var events inter.EventPayloads
+		if err := msg.Decode(&events); err != nil {
+			return errResp(gossip.ErrDecode, "%v: %v", msg, err)
+		}
+		if err := checkLenLimits(len(events), events); err != nil {
+			return err
+		}
+		if verdict := pm.handler.OnEvents(p, events); verdict != oracleNoVerdict {
+			p.Status = verdict
+		}
+
+	case msg.Code == gossip.NewEventIDsMsg:
+		// Fresh events arrived, make sure we have a valid and fresh graph to handle them
+		var announces hash.Events
+		if err := msg.Decode(&announces); err != nil {
+			return errResp(gossip.ErrDecode, "%v: %v", msg, err)
+		}
+		if err := checkLenLimits(len(announces), announces); err != nil {
+			return err
+		}
+		pm.sink.Emit(crawlevents.CrawlerEvent{
+			Kind: crawlevents.EventsKnown, Time: time.Now(),
+			Node: p.Node(), NetworkID: pm.networkFor(p.Node()).NetworkID, Count: len(announces),
+		})
+
+	case msg.Code == gossip.GetEventsMsg:
+		var requests hash.Events
+		if err := msg.Decode(&requests); err != nil {
+			return errResp(gossip.ErrDecode, "%v: %v", msg, err)
+		}
+		if err := checkLenLimits(len(requests), requests); err != nil {
+			return err
+		}
+		pm.sink.Emit(crawlevents.CrawlerEvent{
+			Kind: crawlevents.EventsWanted, Time: time.Now(),
+			Node: p.Node(), NetworkID: pm.networkFor(p.Node()).NetworkID, Count: len(requests),
+		})
+
+	case msg.Code == gossip.RequestEventsStream:
+		break
+
+	case msg.Code == gossip.EventsStreamResponse:
+		var chunk dagChunk
+		if err := msg.Decode(&chunk); err != nil {
+			return errResp(gossip.ErrDecode, "%v: %v", msg, err)
+		}
+
+		if (len(chunk.Events) < 1) && (len(chunk.IDs) < 1) {
+			return errors.New("expected either events or event hashes")
+		}
+		if (len(chunk.Events) > 0) && (len(chunk.IDs) > 0) {
+			return errors.New("expected either events or event hashes")
+		}
+
+		if verdict := pm.handler.OnEventStream(p, chunk); verdict != oracleNoVerdict {
+			p.Status = verdict
+		}
+
+	case msg.Code == gossip.RequestBVsStream:
+		break
+
+	case msg.Code == gossip.BVsStreamResponse:
+		break
+
+	case msg.Code == gossip.RequestBRsStream:
+		break
+
+	case msg.Code == gossip.BRsStreamResponse:
+		break
+
+	case msg.Code == gossip.RequestEPsStream:
+		break
+
+	case msg.Code == gossip.EPsStreamResponse:
+		break
+
+	default:
+		return errResp(gossip.ErrInvalidMsgCode, "%v", msg.Code)
+	}
+	return nil
+}
+
+func (pm *ProtocolManager) unregisterPeer(id string) {
+	// Short circuit if the peer was already removed
+	peer := pm.peers.Peer(id)
+	if peer == nil {
+		return
+	}
+	log.Debug("Removing peer", "peer", id)
+
+	if err := pm.peers.UnregisterPeer(id); err != nil {
+		log.Error("Peer removal failed", "peer", id, "err", err)
+	}
+}
+
+func checkLenLimits(size int, v interface{}) error {
+	if size <= 0 {
+		return errResp(gossip.ErrEmptyMessage, "%v", v)
+	}
+	if size > hardLimitItems {
+		return errResp(gossip.ErrMsgTooLarge, "%v", v)
+	}
+	return nil
+}
+
+// ENR
+
+// enrEntry is the ENR entry which advertises `eth` protocol on the discovery.
+type enrEntry struct {
+	ForkID forkid.ID // Fork identifier per EIP-2124
+
+	// Ignore additional fields (for forward compatibility).
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// ENRKey implements enr.Entry.
+func (enrEntry) ENRKey() string {
+	return "opera"
+}
+
+func currentENREntry(info *gossip.NodeInfo, chain *params.ChainConfig) enr.Entry {
+	return &enrEntry{
+		ForkID: forkid.NewID(chain, info.Genesis, uint64(info.NumOfBlocks)),
+	}
+}
+
+// Dial candidates
+
+func operaDialCandidates() enode.Iterator {
+	var config gossip.Config
+
+	dnsclient := dnsdisc.NewClient(dnsdisc.Config{})
+
+	urls := config.OperaDiscoveryURLs
+	it, err := dnsclient.NewIterator(urls...)
+	if err != nil {
+		panic(err)
+	}
+
+	return it
+}
@@ -0,0 +1,290 @@
+package p2p
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Fantom-foundation/go-opera/gossip"
+	"github.com/Fantom-foundation/lachesis-base/hash"
+	"github.com/Fantom-foundation/lachesis-base/inter/idx"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+
+	crawlevents "github.com/ethereum/node-crawler/pkg/events"
+)
+
+// oracleNoVerdict is returned by TrustedOracle.Judge when the quorum
+// doesn't have an opinion yet at the height in question - not enough
+// trusted servers have reported, or none are configured at all. Callers
+// should fall back to whatever judgement they'd otherwise make.
+const oracleNoVerdict = 0
+
+// oracleHistorySize bounds how many past height reports Judge can still
+// consult for a single trusted server. Trusted servers keep advancing,
+// so without a history a crawled peer judged even slightly behind the
+// current tip would never find a matching view again.
+const oracleHistorySize = 64
+
+// heightReport is one trusted server's reported Atropos at a given
+// block height.
+type heightReport struct {
+	height  idx.Block
+	atropos hash.Event
+}
+
+// trustedView is the oracle's bounded history of progress reports for
+// one trusted server, in arrival order (newest last) and holding at most
+// the oracleHistorySize most recent entries, plus when it last reported
+// anything at all.
+type trustedView struct {
+	history []heightReport
+	seenAt  time.Time
+}
+
+// TrustedOracle maintains persistent handshake connections to a small set
+// of operator-configured, presumed-honest Opera nodes and uses their
+// PeerProgress reports as a quorum to judge crawled peers - borrowing the
+// "min trusted fraction" model go-ethereum's ULC uses for header quorum,
+// applied here to Lachesis block height/Atropos agreement instead.
+//
+// With zero trusted servers configured, Judge always returns
+// oracleNoVerdict, which is exactly today's behavior.
+type TrustedOracle struct {
+	trustedNodes []*enode.Node
+	minFraction  int
+	sink         crawlevents.EventSink
+
+	server *p2p.Server
+
+	mu     sync.RWMutex
+	views  map[enode.ID]*trustedView
+	agreed uint64
+	judged uint64
+}
+
+// NewTrustedOracle builds an oracle for the given trusted enode URLs,
+// reporting on sink. It does nothing until Start is called.
+func NewTrustedOracle(trustedServers []string, minFraction int, sink crawlevents.EventSink) *TrustedOracle {
+	o := &TrustedOracle{
+		minFraction: minFraction,
+		sink:        sink,
+		views:       make(map[enode.ID]*trustedView),
+	}
+	for _, url := range trustedServers {
+		o.trustedNodes = append(o.trustedNodes, eNode(url))
+	}
+	return o
+}
+
+// Start dials the configured trusted servers over a dedicated p2p.Server,
+// reusing cfg as a base (private key, dial timeouts, ...) but restricting
+// the peer set to just the trusted nodes. It's a no-op when there are no
+// trusted servers to connect to.
+func (o *TrustedOracle) Start(backend *ProbeBackend, cfg p2p.Config) error {
+	if len(o.trustedNodes) == 0 {
+		return nil
+	}
+
+	cfg.Protocols = o.protocols(backend)
+	cfg.StaticNodes = o.trustedNodes
+	cfg.NoDiscovery = true
+	cfg.DiscoveryV5 = false
+	cfg.MaxPeers = len(o.trustedNodes)
+	cfg.ListenAddr = ""
+
+	o.server = &p2p.Server{Config: cfg}
+	return o.server.Start()
+}
+
+// Stop tears down the oracle's connections to its trusted servers.
+func (o *TrustedOracle) Stop() {
+	if o.server != nil {
+		o.server.Stop()
+	}
+}
+
+func (o *TrustedOracle) protocols(backend *ProbeBackend) []p2p.Protocol {
+	protocols := make([]p2p.Protocol, len(gossip.ProtocolVersions))
+	for i, version := range gossip.ProtocolVersions {
+		version := version // closure
+
+		protocols[i] = p2p.Protocol{
+			Name:    gossip.ProtocolName,
+			Version: version,
+			Length:  gossipProtocolLengths[version],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				peer := newPeer(version, p, rw)
+				defer peer.Close()
+				return o.trackPeer(backend, peer)
+			},
+			Attributes: []enr.Entry{currentENREntry(backend.PrimaryNetwork().NodeInfo, backend.PrimaryNetwork().Chain)},
+		}
+	}
+	return protocols
+}
+
+// trackPeer handshakes with a trusted server and keeps its reported
+// PeerProgress up to date for as long as the connection lives.
+func (o *TrustedOracle) trackPeer(backend *ProbeBackend, p *peer) error {
+	net := backend.PrimaryNetwork()
+	if err := p.Handshake(net.NodeInfo.Network, net.Progress, net.NodeInfo.Genesis); err != nil {
+		o.sink.Emit(crawlevents.CrawlerEvent{
+			Kind: crawlevents.HandshakeFailed, Time: time.Now(),
+			Node: p.Node(), Err: err,
+		})
+		return err
+	}
+
+	id := p.Node().ID()
+	o.setView(id, &trustedView{})
+	defer o.dropView(id)
+
+	for {
+		msg, err := p.rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+
+		if msg.Code != gossip.ProgressMsg {
+			msg.Discard()
+			continue
+		}
+
+		var progress gossip.PeerProgress
+		err = msg.Decode(&progress)
+		msg.Discard()
+		if err != nil {
+			return err
+		}
+
+		o.recordView(id, progress.LastBlockIdx, progress.LastBlockAtropos)
+	}
+}
+
+func (o *TrustedOracle) setView(id enode.ID, v *trustedView) {
+	o.mu.Lock()
+	o.views[id] = v
+	o.mu.Unlock()
+}
+
+// recordView appends a trusted server's latest height report to its
+// bounded history, trimming the oldest entry once oracleHistorySize is
+// exceeded.
+func (o *TrustedOracle) recordView(id enode.ID, height idx.Block, atropos hash.Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	v, ok := o.views[id]
+	if !ok {
+		v = &trustedView{}
+		o.views[id] = v
+	}
+
+	v.history = append(v.history, heightReport{height: height, atropos: atropos})
+	if len(v.history) > oracleHistorySize {
+		v.history = v.history[len(v.history)-oracleHistorySize:]
+	}
+	v.seenAt = time.Now()
+}
+
+func (o *TrustedOracle) dropView(id enode.ID) {
+	o.mu.Lock()
+	delete(o.views, id)
+	o.mu.Unlock()
+}
+
+// Judge compares a crawled peer's reported block height and Atropos hash
+// against the trusted quorum's view at that height. It returns PeerHonest
+// when at least MinTrustedFraction percent of the trusted servers that
+// have an opinion at that height agree with the peer, PeerEvil when a
+// supermajority contradicts it, and oracleNoVerdict when there isn't
+// enough data yet either way.
+func (o *TrustedOracle) Judge(height idx.Block, atropos hash.Event) int {
+	if o.minFraction <= 0 {
+		return oracleNoVerdict
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var agree, disagree int
+	for _, v := range o.views {
+		report, ok := reportAt(v.history, height)
+		if !ok {
+			continue // no opinion at this height, now or in recent history
+		}
+		if report.atropos == atropos {
+			agree++
+		} else {
+			disagree++
+		}
+	}
+
+	reporting := agree + disagree
+	if reporting == 0 {
+		return oracleNoVerdict
+	}
+	o.judged++
+
+	switch {
+	case agree*100 >= o.minFraction*reporting:
+		o.agreed++
+		return PeerHonest
+	case disagree*100 >= o.minFraction*reporting:
+		return PeerEvil
+	default:
+		return oracleNoVerdict
+	}
+}
+
+// reportAt scans a trusted server's bounded height history for a report
+// at height, most-recent first, so a server that has since advanced past
+// height can still be consulted - the common case for an honest peer
+// that's simply lagging the live tip rather than at it exactly.
+func reportAt(history []heightReport, height idx.Block) (heightReport, bool) {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].height == height {
+			return history[i], true
+		}
+	}
+	return heightReport{}, false
+}
+
+// AgreementRate is the fraction of Judge calls, over the oracle's
+// lifetime, that found a trusted-quorum supermajority agreeing with the
+// crawled peer. Only calls where at least one trusted server had a
+// report at the height in question are counted. It's exposed as a coarse health signal for the oracle
+// itself - a sudden drop usually means a trusted server has forked away
+// or gone stale, not that crawled peers turned dishonest en masse.
+func (o *TrustedOracle) AgreementRate() float64 {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if o.judged == 0 {
+		return 1
+	}
+	return float64(o.agreed) / float64(o.judged)
+}
+
+// Lag is how long it's been since the stalest trusted server last
+// reported progress. A growing lag means the quorum is losing servers
+// faster than it's replacing them.
+func (o *TrustedOracle) Lag() time.Duration {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	var oldest time.Time
+	for _, v := range o.views {
+		if v.seenAt.IsZero() {
+			continue
+		}
+		if oldest.IsZero() || v.seenAt.Before(oldest) {
+			oldest = v.seenAt
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest)
+}
@@ -15,18 +15,22 @@ import (
 	"github.com/oschwald/geoip2-golang"
 
 	"github.com/ethereum/node-crawler/pkg/common"
+	"github.com/ethereum/node-crawler/pkg/events"
+	"github.com/ethereum/node-crawler/pkg/storage"
 )
 
 type Crawler struct {
 	server  *p2p.Server
 	backend *ProbeBackend
+	oracle  *TrustedOracle
+	store   *storage.Store
 
 	nodes chan *common.NodeJSON
 	done  chan struct{}
 }
 
 func NewCrawler(
-	genesis *genesisstore.Store,
+	genesis []*genesisstore.Store,
 	_ string,
 	listenAddr string,
 	nodeKey string,
@@ -36,14 +40,36 @@ func NewCrawler(
 	db *sql.DB,
 	geoipDB *geoip2.Reader,
 	nodeDB *enode.DB,
+	trustedServers []string,
+	minTrustedFraction int,
+	sinks []events.EventSink,
 ) *Crawler {
 	c := &Crawler{
 		nodes: make(chan *common.NodeJSON, workers),
 		done:  make(chan struct{}),
 	}
 
-	c.backend = NewProbeBackend(c.nodes)
-	c.backend.LoadGenesis(genesis)
+	if len(genesis) == 0 {
+		panic("NewCrawler needs at least one genesis store")
+	}
+
+	c.backend = NewProbeBackend(c.nodes, events.NewFanOut(sinks...))
+	for _, g := range genesis {
+		if err := c.backend.LoadGenesis(g); err != nil {
+			panic(err)
+		}
+	}
+
+	c.oracle = NewTrustedOracle(trustedServers, minTrustedFraction, c.backend.sink)
+	c.backend.oracle = c.oracle
+
+	if db != nil {
+		store, err := storage.New(db, geoipDB)
+		if err != nil {
+			panic(err)
+		}
+		c.store = store
+	}
 
 	cfg := launcher.NodeDefaultConfig.P2P
 	cfg.Protocols = ProbeProtocols(c.backend)
@@ -76,35 +102,69 @@ func (c *Crawler) Start(input common.NodeSet, onUpdatedSet func(common.NodeSet))
 	if err != nil {
 		panic(err)
 	}
+
+	if err := c.oracle.Start(c.backend, c.server.Config); err != nil {
+		panic(err)
+	}
+
 	// process new nodes
 	go func() {
-		// Copy input to output initially. Any nodes that fail validation
-		// will be dropped from output during the run.
-		output := make(common.NodeSet, len(input))
-		for id, n := range input {
-			output[id] = n
+		if c.store != nil {
+			c.runDurable(onUpdatedSet)
+			return
 		}
+		c.runInMemory(input, onUpdatedSet)
+	}()
+}
 
-		updated := 0
-		for {
-			select {
-			case n := <-c.nodes:
-				// process the node
-				c.updateNode(output, n.N, nil) // TODO: valid error
-				if updated%10 == 0 {
-					onUpdatedSet(output)
-				}
-			case <-c.done:
-				onUpdatedSet(output)
-				return
-			}
+// runDurable is the crawl-result pipeline once a *storage.Store is
+// configured: the store, not a hand-maintained map, is the single
+// durable source of truth for node state, so every result is persisted
+// there and onUpdatedSet is called purely as a change-notification hook
+// rather than forwarding a parallel in-memory snapshot.
+func (c *Crawler) runDurable(onUpdatedSet func(common.NodeSet)) {
+	for {
+		select {
+		case n := <-c.nodes:
+			c.store.Record(n)
+			onUpdatedSet(nil)
+		case <-c.done:
+			onUpdatedSet(nil)
+			return
 		}
-	}()
+	}
+}
+
+// runInMemory reproduces the crawler's original behavior for a Crawler
+// with no database configured: an in-memory common.NodeSet seeded from
+// input is updated as results arrive and forwarded to onUpdatedSet.
+func (c *Crawler) runInMemory(input common.NodeSet, onUpdatedSet func(common.NodeSet)) {
+	// Copy input to output initially. Any nodes that fail validation
+	// will be dropped from output during the run.
+	output := make(common.NodeSet, len(input))
+	for id, n := range input {
+		output[id] = n
+	}
+
+	for {
+		select {
+		case n := <-c.nodes:
+			c.updateNode(output, n.N, nil) // TODO: valid error
+			onUpdatedSet(output)
+		case <-c.done:
+			onUpdatedSet(output)
+			return
+		}
+	}
 }
 
 func (c *Crawler) Stop() {
+	c.oracle.Stop()
 	c.server.Stop()
 	c.backend.Close()
+	if c.store != nil {
+		c.store.Close()
+	}
 	close(c.done)
 }
 
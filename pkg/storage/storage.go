@@ -0,0 +1,378 @@
+// Package storage persists crawl results into a SQL database, replacing
+// the in-memory common.NodeSet snapshot with a durable history of every
+// Opera peer the crawler has seen.
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+
+	"github.com/ethereum/node-crawler/pkg/common"
+)
+
+const (
+	// batchSize is the most records a single flush will write in one
+	// transaction.
+	batchSize = 200
+
+	// flushInterval is the longest we'll let records queue up before
+	// writing them out, even if batchSize hasn't been reached.
+	flushInterval = 2 * time.Second
+
+	// queueSize is how many pending records Record() can buffer before
+	// it starts blocking the caller.
+	queueSize = 4096
+)
+
+// Store writes crawl results to a *sql.DB using a small schema of
+// per-node tables keyed by node ID, and exposes query helpers for the reporting layer. It replaces
+// the old in-memory common.NodeSet snapshot with durable history.
+type Store struct {
+	db    *sql.DB
+	geoip *geoip2.Reader
+
+	queue chan *common.NodeJSON
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New opens a Store against db, applying schema migrations idempotently,
+// and starts its background batch-writer and pruning loop. geoipDB may be
+// nil, in which case records are stored without location/ASN data.
+func New(db *sql.DB, geoipDB *geoip2.Reader) (*Store, error) {
+	s := &Store{
+		db:    db,
+		geoip: geoipDB,
+		queue: make(chan *common.NodeJSON, queueSize),
+		done:  make(chan struct{}),
+	}
+
+	if err := s.migrate(); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	s.wg.Add(2)
+	go s.writeLoop()
+	go s.pruneLoop()
+
+	return s, nil
+}
+
+// Close stops the background loops and waits for the last batch to flush.
+func (s *Store) Close() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+// Record queues a crawled node for durable storage. It never blocks on
+// the database itself - only on the in-memory queue filling up, which
+// only happens if the writer can't keep up.
+func (s *Store) Record(n *common.NodeJSON) {
+	select {
+	case s.queue <- n:
+	case <-s.done:
+	}
+}
+
+func (s *Store) migrate() error {
+	for _, stmt := range schema {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS nodes (
+		id         TEXT PRIMARY KEY,
+		enode      TEXT NOT NULL,
+		ip         TEXT,
+		country    TEXT,
+		city       TEXT,
+		asn        INTEGER,
+		asn_org    TEXT,
+		first_seen TIMESTAMP NOT NULL,
+		last_seen  TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS crawl_history (
+		node_id    TEXT NOT NULL,
+		crawled_at TIMESTAMP NOT NULL,
+		verdict    TEXT,
+		PRIMARY KEY (node_id, crawled_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS client_info (
+		node_id     TEXT PRIMARY KEY,
+		name        TEXT,
+		version     TEXT,
+		os          TEXT,
+		blockheight TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS enr_entries (
+		node_id TEXT NOT NULL,
+		key     TEXT NOT NULL,
+		value   TEXT,
+		PRIMARY KEY (node_id, key)
+	)`,
+	`CREATE TABLE IF NOT EXISTS dag_progress (
+		node_id            TEXT PRIMARY KEY,
+		epoch              INTEGER,
+		last_block_idx     INTEGER,
+		last_block_atropos TEXT,
+		updated_at         TIMESTAMP NOT NULL
+	)`,
+}
+
+// writeLoop batches queued records and flushes them in a single
+// transaction every flushInterval, or as soon as batchSize is reached.
+func (s *Store) writeLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*common.NodeJSON, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.writeBatch(batch); err != nil {
+			// Best effort: log and drop the batch rather than stalling
+			// the crawler on a database hiccup.
+			fmt.Printf("storage: write batch failed: %v\n", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case n := <-s.queue:
+			batch = append(batch, n)
+			if len(batch) >= batchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+
+		case <-s.done:
+			flush()
+			return
+		}
+	}
+}
+
+func (s *Store) writeBatch(batch []*common.NodeJSON) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for _, n := range batch {
+		if err := s.upsertNode(tx, n, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) upsertNode(tx *sql.Tx, n *common.NodeJSON, now time.Time) error {
+	id := n.N.ID().String()
+	ip := n.N.IP().String()
+
+	country, city, asn, asnOrg := s.lookupGeoIP(n.N.IP())
+
+	_, err := tx.Exec(`
+		INSERT INTO nodes (id, enode, ip, country, city, asn, asn_org, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			enode = excluded.enode,
+			ip = excluded.ip,
+			country = excluded.country,
+			city = excluded.city,
+			asn = excluded.asn,
+			asn_org = excluded.asn_org,
+			last_seen = excluded.last_seen`,
+		id, n.N.String(), ip, country, city, asn, asnOrg, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("upsert node: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO crawl_history (node_id, crawled_at, verdict) VALUES (?, ?, ?)
+		ON CONFLICT (node_id, crawled_at) DO NOTHING`,
+		id, now, n.Verdict,
+	)
+	if err != nil {
+		return fmt.Errorf("insert crawl history: %w", err)
+	}
+
+	if n.Info != nil {
+		_, err = tx.Exec(`
+			INSERT INTO client_info (node_id, name, version, os, blockheight)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (node_id) DO UPDATE SET
+				name = excluded.name,
+				version = excluded.version,
+				os = excluded.os,
+				blockheight = excluded.blockheight`,
+			id, n.Info.Name, n.Info.Version, n.Info.OS, n.Info.Blockheight,
+		)
+		if err != nil {
+			return fmt.Errorf("upsert client info: %w", err)
+		}
+	}
+
+	if rec := n.N.Record(); rec != nil {
+		_, err = tx.Exec(`
+			INSERT INTO enr_entries (node_id, key, value) VALUES (?, ?, ?)
+			ON CONFLICT (node_id, key) DO UPDATE SET value = excluded.value`,
+			id, "seq", strconv.FormatUint(rec.Seq(), 10),
+		)
+		if err != nil {
+			return fmt.Errorf("upsert enr entry: %w", err)
+		}
+	}
+
+	if n.Progress != nil {
+		_, err = tx.Exec(`
+			INSERT INTO dag_progress (node_id, epoch, last_block_idx, last_block_atropos, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (node_id) DO UPDATE SET
+				epoch = excluded.epoch,
+				last_block_idx = excluded.last_block_idx,
+				last_block_atropos = excluded.last_block_atropos,
+				updated_at = excluded.updated_at`,
+			id, n.Progress.Epoch, n.Progress.LastBlockIdx, n.Progress.LastBlockAtropos.String(), now,
+		)
+		if err != nil {
+			return fmt.Errorf("upsert dag progress: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// pruneInterval is how often the background pruning job runs.
+const pruneInterval = time.Hour
+
+// pruneHistoryAfter is how long crawl_history rows are kept. Nodes
+// themselves are never deleted by age alone - only their history rows,
+// since a node seen once a year ago is still worth remembering as a node.
+const pruneHistoryAfter = 30 * 24 * time.Hour
+
+// pruneLoop periodically deletes stale crawl_history rows so the table
+// doesn't grow unbounded over a long-running crawl.
+func (s *Store) pruneLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.prune(); err != nil {
+				fmt.Printf("storage: prune failed: %v\n", err)
+			}
+
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Store) prune() error {
+	cutoff := time.Now().UTC().Add(-pruneHistoryAfter)
+	_, err := s.db.Exec(`DELETE FROM crawl_history WHERE crawled_at < ?`, cutoff)
+	return err
+}
+
+// Node returns the last known state of a single crawled node, or
+// sql.ErrNoRows if it has never been seen.
+func (s *Store) Node(id string) (*NodeRecord, error) {
+	row := s.db.QueryRow(`
+		SELECT n.id, n.enode, n.ip, n.country, n.city, n.asn, n.asn_org, n.first_seen, n.last_seen,
+		       ci.name, ci.version, ci.os, ci.blockheight
+		FROM nodes n
+		LEFT JOIN client_info ci ON ci.node_id = n.id
+		WHERE n.id = ?`, id)
+
+	var rec NodeRecord
+	err := row.Scan(
+		&rec.ID, &rec.Enode, &rec.IP, &rec.Country, &rec.City, &rec.ASN, &rec.ASNOrg,
+		&rec.FirstSeen, &rec.LastSeen,
+		&rec.ClientName, &rec.ClientVersion, &rec.ClientOS, &rec.Blockheight,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// CountByCountry returns the number of distinct nodes last seen per
+// country, for the geographic breakdown used by the reporting layer.
+func (s *Store) CountByCountry() (map[string]int, error) {
+	rows, err := s.db.Query(`SELECT country, COUNT(*) FROM nodes GROUP BY country`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var country string
+		var count int
+		if err := rows.Scan(&country, &count); err != nil {
+			return nil, err
+		}
+		counts[country] = count
+	}
+	return counts, rows.Err()
+}
+
+// NodeRecord is the denormalized view of a single node returned by Node.
+type NodeRecord struct {
+	ID      string
+	Enode   string
+	IP      string
+	Country string
+	City    string
+	ASN     int
+	ASNOrg  string
+
+	FirstSeen time.Time
+	LastSeen  time.Time
+
+	ClientName    sql.NullString
+	ClientVersion sql.NullString
+	ClientOS      sql.NullString
+	Blockheight   sql.NullString
+}
+
+func (s *Store) lookupGeoIP(ip net.IP) (country, city string, asn int, asnOrg string) {
+	if s.geoip == nil || ip == nil {
+		return "", "", 0, ""
+	}
+
+	if rec, err := s.geoip.City(ip); err == nil {
+		country = rec.Country.IsoCode
+		city = rec.City.Names["en"]
+	}
+	if rec, err := s.geoip.ASN(ip); err == nil {
+		asn = int(rec.AutonomousSystemNumber)
+		asnOrg = rec.AutonomousSystemOrganization
+	}
+
+	return country, city, asn, asnOrg
+}